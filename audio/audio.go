@@ -0,0 +1,250 @@
+// Package audio assembles the individual speech and background clips that
+// make up a CDAdventure conversion into the single OutputPath file promised
+// by the manifest, shelling out to ffmpeg to do the actual concatenation and
+// mixing.
+package audio
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Clip is one piece of per-track speech to be appended to the final output,
+// along with the chapter metadata it should be marked with.
+type Clip struct {
+	ID      string        // track ID, used as a fallback chapter title
+	Title   string        // chapter title
+	Path    string        // path to the rendered speech audio for this clip
+	Options []OptionEntry // option prompts spoken in this clip, for the LRC/SRT sidecar
+}
+
+// OptionEntry associates a spoken option's label with the track it redirects
+// to, so timestamp-redirect mode can annotate it with the destination's
+// chapter time in the LRC/SRT sidecar.
+type OptionEntry struct {
+	Label    string // the option text as spoken
+	TargetID string // track ID the option redirects to
+}
+
+// Chapter is a single chapter mark in the assembled output, expressed as an
+// offset in seconds from the start of the file.
+type Chapter struct {
+	ID    string
+	Title string
+	Start float64
+}
+
+// Options describes everything Assemble needs to build the final output.
+type Options struct {
+	OutputPath          string  // where the muxed/tagged result should be written
+	PreambleSpeechPath  string  // rendered preamble speech, "" if there is none
+	PreambleAudioFile   string  // preamble background audio file, "" if none
+	Merge               bool    // whether PreambleSpeechPath and PreambleAudioFile should be mixed together
+	AudioFileVolume     float64 // volume applied to PreambleAudioFile when Merge is set
+	StartingSpeechDelay float64 // seconds of silence inserted after the preamble
+	Clips               []Clip  // per-track speech clips, in play order
+	PostSpeechPath      string  // rendered post-game speech, "" if none
+	RedirectType        string  // "timestamp" or "skip"; option lines in the sidecar are only emitted in timestamp mode
+	SaveLrcFile         bool    // write an .lrc sidecar alongside OutputPath
+	SaveSrtFile         bool    // write an .srt sidecar alongside OutputPath
+	SidecarBasePath     string  // base path (without extension) for .lrc/.srt files; derived from OutputPath if ""
+	LrcFormat           string  // fmt format string (one %s verb) for chapter title lines; defaults to "%s"
+}
+
+// Assemble concatenates the preamble, background audio, per-track speech and
+// post-game speech into Options.OutputPath using ffmpeg, and returns the
+// chapter marks for each clip so timestamp-redirect mode has real timestamps
+// to reference.
+func Assemble(opts Options) ([]Chapter, error) {
+	workDir, err := os.MkdirTemp("", "podcda-assembly")
+	if err != nil {
+		return nil, fmt.Errorf("creating assembly work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	var segments []string
+
+	preambleSegments, err := buildPreamble(workDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	segments = append(segments, preambleSegments...)
+
+	if opts.StartingSpeechDelay > 0 {
+		silencePath := filepath.Join(workDir, "silence.mp3")
+		if err := runFfmpeg("-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo",
+			"-t", strconv.FormatFloat(opts.StartingSpeechDelay, 'f', -1, 64),
+			"-q:a", "9", silencePath); err != nil {
+			return nil, fmt.Errorf("generating starting silence: %w", err)
+		}
+		segments = append(segments, silencePath)
+	}
+
+	var elapsed float64
+	for _, segment := range segments {
+		d, err := probeDuration(segment)
+		if err != nil {
+			return nil, err
+		}
+		elapsed += d
+	}
+
+	var chapters []Chapter
+	for _, clip := range opts.Clips {
+		title := clip.Title
+		if title == "" {
+			title = clip.ID
+		}
+		chapters = append(chapters, Chapter{ID: clip.ID, Title: title, Start: elapsed})
+		d, err := probeDuration(clip.Path)
+		if err != nil {
+			return nil, err
+		}
+		elapsed += d
+		segments = append(segments, clip.Path)
+	}
+
+	if opts.PostSpeechPath != "" {
+		segments = append(segments, opts.PostSpeechPath)
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("nothing to assemble")
+	}
+
+	// The concat demuxer requires every input to share the same codec and
+	// parameters, but segments arrive in whatever format each stage produced
+	// (m4a preamble mix, arbitrary background file, mp3 speech clips).
+	// Normalize each to a common AAC/m4a before handing them to concat.
+	normalized, err := normalizeSegments(workDir, segments)
+	if err != nil {
+		return nil, err
+	}
+
+	listPath := filepath.Join(workDir, "concat.txt")
+	var list strings.Builder
+	for _, segment := range normalized {
+		abs, err := filepath.Abs(segment)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", segment, err)
+		}
+		list.WriteString("file '" + strings.ReplaceAll(abs, "'", "'\\''") + "'\n")
+	}
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return nil, fmt.Errorf("writing concat list: %w", err)
+	}
+
+	metadataPath := filepath.Join(workDir, "chapters.txt")
+	if err := writeChapterMetadata(metadataPath, chapters, elapsed); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.OutputPath), 0755); err != nil {
+		return nil, fmt.Errorf("creating output dir: %w", err)
+	}
+	if err := runFfmpeg("-y", "-f", "concat", "-safe", "0", "-i", listPath,
+		"-i", metadataPath, "-map_metadata", "1",
+		"-c:a", "aac", "-movflags", "+faststart", opts.OutputPath); err != nil {
+		return nil, fmt.Errorf("muxing final output: %w", err)
+	}
+
+	if opts.SaveLrcFile || opts.SaveSrtFile {
+		if err := writeSidecars(opts, chapters); err != nil {
+			return nil, err
+		}
+	}
+
+	return chapters, nil
+}
+
+// buildPreamble renders the preamble segment(s), mixing speech with
+// background audio via an amix/volume filter when Merge is set, and returns
+// the ordered list of files that make up the preamble.
+func buildPreamble(workDir string, opts Options) ([]string, error) {
+	switch {
+	case opts.Merge && opts.PreambleSpeechPath != "" && opts.PreambleAudioFile != "":
+		mixedPath := filepath.Join(workDir, "preamble_mixed.m4a")
+		filter := fmt.Sprintf("[1:a]volume=%s[bg];[0:a][bg]amix=inputs=2:duration=longest[aout]",
+			strconv.FormatFloat(opts.AudioFileVolume, 'f', -1, 64))
+		if err := runFfmpeg("-y", "-i", opts.PreambleSpeechPath, "-i", opts.PreambleAudioFile,
+			"-filter_complex", filter, "-map", "[aout]", mixedPath); err != nil {
+			return nil, fmt.Errorf("mixing preamble: %w", err)
+		}
+		return []string{mixedPath}, nil
+	case opts.PreambleSpeechPath != "" && opts.PreambleAudioFile != "":
+		return []string{opts.PreambleSpeechPath, opts.PreambleAudioFile}, nil
+	case opts.PreambleAudioFile != "":
+		return []string{opts.PreambleAudioFile}, nil
+	case opts.PreambleSpeechPath != "":
+		return []string{opts.PreambleSpeechPath}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// normalizeSegments transcodes each segment to a common AAC/m4a codec in
+// workDir so the concat demuxer, which requires uniform codec parameters
+// across inputs, can join the preamble mix, background audio and mp3 speech
+// clips without erroring or glitching.
+func normalizeSegments(workDir string, segments []string) ([]string, error) {
+	var normalized = make([]string, len(segments))
+	for i, segment := range segments {
+		out := filepath.Join(workDir, fmt.Sprintf("seg%d.m4a", i))
+		if err := runFfmpeg("-y", "-i", segment, "-c:a", "aac", "-ar", "44100", "-ac", "2", out); err != nil {
+			return nil, fmt.Errorf("normalizing %s: %w", segment, err)
+		}
+		normalized[i] = out
+	}
+	return normalized, nil
+}
+
+// writeChapterMetadata renders chapters as an ffmetadata file suitable for
+// `ffmpeg -i meta.txt -map_metadata 1`, so the muxed output carries real
+// embedded chapter marks instead of just the Chapter values Assemble returns.
+func writeChapterMetadata(path string, chapters []Chapter, totalDuration float64) error {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for i, chapter := range chapters {
+		end := totalDuration
+		if i+1 < len(chapters) {
+			end = chapters[i+1].Start
+		}
+		title := chapter.Title
+		if title == "" {
+			title = chapter.ID
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(chapter.Start*1000), int64(end*1000), title)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// runFfmpeg shells out to ffmpeg with the given arguments, surfacing its
+// combined output on failure.
+func runFfmpeg(args ...string) error {
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg %s: %w\n%s", strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// probeDuration returns the duration of path in seconds via ffprobe.
+func probeDuration(path string) (float64, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("probing duration of %s: %w", path, err)
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing duration of %s: %w", path, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarLine is a single timestamped entry in the generated LRC/SRT file.
+type sidecarLine struct {
+	Start float64
+	Text  string
+}
+
+// writeSidecars renders Options.LrcFormat-formatted chapter lines (and, in
+// timestamp-redirect mode, option-prompt lines pointing at their target
+// chapter's timestamp) to an .lrc and/or .srt file alongside OutputPath.
+func writeSidecars(opts Options, chapters []Chapter) error {
+	var format = opts.LrcFormat
+	if format == "" {
+		format = "%s"
+	}
+	var startByID = make(map[string]float64, len(chapters))
+	for _, chapter := range chapters {
+		startByID[chapter.ID] = chapter.Start
+	}
+
+	var lines []sidecarLine
+	for i, clip := range opts.Clips {
+		var chapter = chapters[i]
+		lines = append(lines, sidecarLine{Start: chapter.Start, Text: fmt.Sprintf(format, chapter.Title)})
+		if opts.RedirectType != "timestamp" {
+			continue
+		}
+		for _, option := range clip.Options {
+			targetStart, ok := startByID[option.TargetID]
+			if !ok {
+				continue
+			}
+			lines = append(lines, sidecarLine{
+				Start: chapter.Start,
+				Text:  fmt.Sprintf("%s -> %s", option.Label, formatClockTime(targetStart)),
+			})
+		}
+	}
+
+	var base = opts.SidecarBasePath
+	if base == "" {
+		base = strings.TrimSuffix(opts.OutputPath, filepath.Ext(opts.OutputPath))
+	}
+	if opts.SaveLrcFile {
+		if err := writeLRC(base+".lrc", lines); err != nil {
+			return err
+		}
+	}
+	if opts.SaveSrtFile {
+		if err := writeSRT(base+".srt", lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLRC(path string, lines []sidecarLine) error {
+	var b strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&b, "[%s]%s\n", formatLRCTime(line.Start), line.Text)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func writeSRT(path string, lines []sidecarLine) error {
+	var b strings.Builder
+	for i, line := range lines {
+		var end = line.Start + 4 // default 4-second display window for the last/only line
+		if i+1 < len(lines) {
+			end = lines[i+1].Start
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatSRTTime(line.Start), formatSRTTime(end), line.Text)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// formatClockTime renders seconds as mm:ss, for embedding a target track's
+// timestamp inside a spoken option's sidecar line.
+func formatClockTime(seconds float64) string {
+	var m = int(seconds) / 60
+	var s = int(seconds) % 60
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
+// formatLRCTime renders seconds in the LRC mm:ss.xx timestamp format.
+func formatLRCTime(seconds float64) string {
+	var m = int(seconds) / 60
+	var s = seconds - float64(m*60)
+	return fmt.Sprintf("%02d:%05.2f", m, s)
+}
+
+// formatSRTTime renders seconds in the SRT hh:mm:ss,mmm timestamp format.
+func formatSRTTime(seconds float64) string {
+	var h = int(seconds) / 3600
+	var m = (int(seconds) % 3600) / 60
+	var s = int(seconds) % 60
+	var ms = int((seconds - float64(int(seconds))) * 1000)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
+}
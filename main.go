@@ -1,15 +1,23 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	gtts "github.com/Duckduckgot/gtts"
+	audio "github.com/AverseABFun/PodCDA/audio"
+	tts "github.com/AverseABFun/PodCDA/tts"
 	graph "github.com/dominikbraun/graph"
+	progressbar "github.com/schollz/progressbar/v3"
 )
 
 const RedirectTypeTimestamp = "timestamp"
@@ -18,6 +26,30 @@ const RedirectTypeSkip = "skip"
 const SorterTypeNone = "none"
 const SorterTypeShortestSkip = "shortest_skip"
 
+var selectFlag = flag.Bool("select", false, "render only a subset of the adventure, as described by --tracks and/or --from")
+var tracksFlag = flag.String("tracks", "", "with --select, a comma-separated list of 1-based track positions/ranges to render, e.g. 1,3,5-8")
+var fromFlag = flag.String("from", "", "with --select, the ID of the track to start rendering from")
+var dryRunFlag = flag.Bool("dry-run", false, "print the sort order, estimated timestamps and generated speech strings without synthesizing any audio")
+
+// logger prefixes diagnostics with an [info]/[warn]/[error] level so they can
+// be told apart. It prints straight to stdout and does not coordinate with an
+// in-progress progress bar.
+type logger struct{}
+
+func (logger) Info(args ...interface{}) {
+	fmt.Println(append([]interface{}{"[info]"}, args...)...)
+}
+
+func (logger) Warn(args ...interface{}) {
+	fmt.Println(append([]interface{}{"[warn]"}, args...)...)
+}
+
+func (logger) Error(args ...interface{}) {
+	fmt.Println(append([]interface{}{"[error]"}, args...)...)
+}
+
+var log = logger{}
+
 type overrides struct {
 	Options_prefix                  string
 	Options_item_separator          string
@@ -31,6 +63,7 @@ type overrides struct {
 	Options_seconds_suffix_plural   string
 	Options_seconds_suffix_singular string
 	Request_to_pause                string
+	LrcFormat                       string // fmt format string (one %s verb) for chapter title lines in the LRC/SRT sidecar
 }
 
 var currentOverrides = overrides{
@@ -46,17 +79,21 @@ var currentOverrides = overrides{
 	Options_seconds_suffix_plural:   " seconds. ",
 	Options_seconds_suffix_singular: " seconds. ",
 	Request_to_pause:                "Please pause and make your decision now. ",
+	LrcFormat:                       "%s",
 }
 
 type ConversionManifest struct {
-	Version      int       // Version of the manifest, currently only version 1 is supported
-	Path         string    // Path to the manifest generated by the CDAdventure compiler
-	OutputPath   string    // Path to the output audio file
-	Preamble     string    // Path to the preamble manifest
-	Overrides    overrides // Overrides for the default text
-	RedirectType string    // Redirect type(i.e. timestamp or skip)
-	Sorter       string    // Sorter type(i.e. none or shortest_skip)
-	LastEnd      string    // ID of the end track that should be sorted to the end(not used with sorter none)
+	Version      int        // Version of the manifest, currently only version 1 is supported
+	Path         string     // Path to the manifest generated by the CDAdventure compiler
+	OutputPath   string     // Path to the output audio file
+	Preamble     string     // Path to the preamble manifest
+	Overrides    overrides  // Overrides for the default text
+	RedirectType string     // Redirect type(i.e. timestamp or skip)
+	Sorter       string     // Sorter type(i.e. none or shortest_skip)
+	LastEnd      string     // ID of the end track that should be sorted to the end(not used with sorter none)
+	TTS          tts.Config // TTS backend selection (provider, voice, rate) for speech generation
+	SaveLrcFile  bool       // write an .lrc sidecar alongside OutputPath
+	SaveSrtFile  bool       // write an .srt sidecar alongside OutputPath
 }
 
 type Preamble struct {
@@ -77,14 +114,7 @@ type Track struct {
 	Options        map[string]int // Options of the track
 	End            bool           // Whether the track is the end of the game(there can be more then one end)
 	NoAppend       bool           // Identical to End
-}
-
-type IDTrack struct {
-	ID             string            // ID of the track
-	OriginalSpeech string            // Speech of the track
-	Title          string            // Title of the track
-	Options        map[string]string // Options of the track
-	End            bool              // Whether the track is the end of the game(there can be more then one end)
+	VoiceOverride  string         // Per-track TTS voice id, overriding ConversionManifest.TTS.Voice when set
 }
 
 func trackHash(t Track) string {
@@ -180,7 +210,13 @@ func CheckPreamble(preamble Preamble) (bool, string) {
 	return true, ""
 }
 
-func CheckCDAdventureManifest(manifest CDAdventureManifest) (bool, string) {
+// CheckCDAdventureManifest validates manifest. When relaxed is set (i.e. the
+// manifest has already been narrowed by --select), an option whose target
+// index falls outside the track list is only warned about and left in
+// place, rather than rejected, since SelectTracks drops exactly such
+// dangling options itself and a caller validating before selection would
+// otherwise have to reject every adventure with unreached branches.
+func CheckCDAdventureManifest(manifest CDAdventureManifest, relaxed bool) (bool, string) {
 	if manifest.Version != 1 {
 		return false, "Invalid manifest version"
 	}
@@ -216,10 +252,17 @@ func CheckCDAdventureManifest(manifest CDAdventureManifest) (bool, string) {
 		if len(track.Options) == 0 && !track.End {
 			return false, "Invalid track options at track " + track.ID
 		}
-		for option := range track.Options {
+		for option, targetIndex := range track.Options {
 			if option == "" {
 				return false, "Invalid option ID at track " + track.ID
 			}
+			if targetIndex < 0 || targetIndex >= len(manifest.Tracks) {
+				if relaxed {
+					log.Warn("option", option, "at track", track.ID, "redirects to an out-of-range track index, ignoring")
+					continue
+				}
+				return false, "Option " + option + " at track " + track.ID + " redirects to an invalid track index"
+			}
 		}
 	}
 	return true, ""
@@ -243,139 +286,488 @@ func GetIndexOfTrack(tracks []Track, id string) int {
 	return -1
 }
 
-func AddTrackToTracksNoOverwrite(tracks []Track, track Track, index int) ([]Track, error) {
-	var found, _ = GetTrackByID(tracks, track.ID)
-	if !found {
-		fmt.Println(track.ID)
-		return tracks, fmt.Errorf("Track not found in tracks")
+// parseTrackSelection parses a --tracks spec such as "1,3,5-8" into the set
+// of 1-based track positions it refers to.
+func parseTrackSelection(spec string) (map[int]bool, error) {
+	var selected = make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if dash := strings.Index(part, "-"); dash > 0 {
+			var start, err1 = strconv.Atoi(part[:dash])
+			var end, err2 = strconv.Atoi(part[dash+1:])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid track range %q", part)
+			}
+			for i := start; i <= end; i++ {
+				selected[i] = true
+			}
+			continue
+		}
+		var n, err = strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid track index %q", part)
+		}
+		selected[n] = true
 	}
-	var indexOfTrack = GetIndexOfTrack(tracks, track.ID)
-	if indexOfTrack == index {
+	return selected, nil
+}
+
+// SelectTracks filters tracks down to the subset described by tracksSpec
+// and/or fromID, remapping each kept track's Options indices to match the
+// new, filtered order. An option that redirected to a track excluded by the
+// selection is dropped with a warning rather than left dangling, and a track
+// left with no options is marked as an End so the manifest stays valid.
+func SelectTracks(tracks []Track, tracksSpec string, fromID string) ([]Track, error) {
+	if tracksSpec == "" && fromID == "" {
 		return tracks, nil
 	}
-	var newTracks []Track = tracks
-	newTracks = append(newTracks[:indexOfTrack], track)
-	newTracks = append(newTracks, tracks[indexOfTrack:]...)
-	return newTracks, nil
+
+	var keep = make(map[int]bool)
+	if tracksSpec != "" {
+		var selection, err = parseTrackSelection(tracksSpec)
+		if err != nil {
+			return nil, err
+		}
+		for i := range tracks {
+			if selection[i+1] {
+				keep[i] = true
+			}
+		}
+	}
+	if fromID != "" {
+		var idx = GetIndexOfTrack(tracks, fromID)
+		if idx == -1 {
+			return nil, fmt.Errorf("--from track %q not found", fromID)
+		}
+		for i := idx; i < len(tracks); i++ {
+			keep[i] = true
+		}
+	}
+
+	var newIndex = make(map[int]int, len(keep))
+	var filtered []Track
+	for i, track := range tracks {
+		if !keep[i] {
+			continue
+		}
+		newIndex[i] = len(filtered)
+		filtered = append(filtered, track)
+	}
+
+	for i := range filtered {
+		var remapped = make(map[string]int, len(filtered[i].Options))
+		for option, targetIndex := range filtered[i].Options {
+			if mapped, ok := newIndex[targetIndex]; ok {
+				remapped[option] = mapped
+			} else {
+				log.Warn("option", option, "at track", filtered[i].ID, "redirects to a track excluded by --select, dropping it")
+			}
+		}
+		filtered[i].Options = remapped
+		if len(filtered[i].Options) == 0 {
+			filtered[i].End = true
+		}
+	}
+
+	return filtered, nil
+}
+
+// estimateSpeechDuration roughly guesses how long speech will take to play
+// for --dry-run previews, without actually synthesizing any audio.
+func estimateSpeechDuration(text string) float64 {
+	const charsPerSecond = 15.0
+	return float64(len(text)) / charsPerSecond
+}
+
+// moveToFront returns a copy of order with value moved to the first slot.
+func moveToFront(order []int, value int) []int {
+	var result = make([]int, 0, len(order))
+	result = append(result, value)
+	for _, v := range order {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
 }
 
-func CreateIDTrack(track Track, cdAdventure CDAdventure) IDTrack {
-	var idTrack = IDTrack{
-		ID:             track.ID,
-		OriginalSpeech: track.OriginalSpeech,
-		Title:          track.Title,
-		Options:        make(map[string]string),
-		End:            track.End,
+// moveToBack returns a copy of order with value moved to the last slot.
+func moveToBack(order []int, value int) []int {
+	var result = make([]int, 0, len(order))
+	for _, v := range order {
+		if v != value {
+			result = append(result, v)
+		}
 	}
-	for option, optionID := range track.Options {
-		var track = cdAdventure.Manifest.Tracks[optionID]
-		idTrack.Options[option] = track.ID
+	result = append(result, value)
+	return result
+}
+
+// repairEndOrdering moves any End/NoAppend track that the BFS seed placed
+// before a track whose option redirects to it to just after that
+// predecessor, so the hard constraint enforced on 2-opt swaps also holds for
+// the order the 2-opt pass starts from. order[0] (Beginning) and, when
+// lastEndPinned, order[len(order)-1] (LastEnd) are left untouched.
+func repairEndOrdering(order []int, tracks []Track, lastEndPinned bool) []int {
+	var n = len(order)
+	var lowerBound, upperBound = 1, n
+	if lastEndPinned {
+		upperBound = n - 1
+	}
+	for pass := 0; pass < n; pass++ {
+		var position = make([]int, len(tracks))
+		for slot, idx := range order {
+			position[idx] = slot
+		}
+		var fixed = false
+		for i, track := range tracks {
+			for _, target := range track.Options {
+				if target < 0 || target >= len(tracks) {
+					continue
+				}
+				if !(tracks[target].End || tracks[target].NoAppend) {
+					continue
+				}
+				if position[target] >= position[i] {
+					continue
+				}
+				var targetSlot, destSlot = position[target], position[i]
+				if targetSlot < lowerBound || targetSlot >= upperBound {
+					continue
+				}
+				if destSlot >= upperBound {
+					destSlot = upperBound - 1
+				}
+				var moved = order[targetSlot]
+				order = append(order[:targetSlot], order[targetSlot+1:]...)
+				if targetSlot < destSlot {
+					destSlot--
+				}
+				var rest = append([]int{}, order[destSlot+1:]...)
+				order = append(append(order[:destSlot+1], moved), rest...)
+				fixed = true
+				break
+			}
+			if fixed {
+				break
+			}
+		}
+		if !fixed {
+			break
+		}
 	}
-	return idTrack
+	return order
 }
 
-func SortTracks(tracks []Track, data CDAdventure) []Track {
+// SortTracks orders tracks in play order for this CDAdventure. With
+// SorterTypeNone it returns tracks unchanged (cost 0). With
+// SorterTypeShortestSkip it models tracks as nodes and each option as a
+// directed edge weighted by the skip distance between its source and target
+// positions, seeds an order with a BFS from Meta.Beginning, repairs that seed
+// so no End/NoAppend track precedes a predecessor that redirects to it, then
+// runs a 2-opt pass swapping adjacent non-terminal tracks to shrink the total
+// weighted skip distance, rejecting any swap that would reintroduce such a
+// violation. Meta.Beginning is pinned at index 0 and ConversionManifest.LastEnd
+// at the last index. It returns the resulting order along with its total skip
+// cost.
+func SortTracks(tracks []Track, data CDAdventure) ([]Track, float64) {
 	if data.ConversionManifest.Sorter == SorterTypeNone {
-		return tracks
+		return tracks, 0
 	}
-	var _, beginning = GetTrackByID(tracks, data.Manifest.Meta.Beginning)
-	tracks, err := AddTrackToTracksNoOverwrite(tracks, beginning, 0)
-	var IDTracks []IDTrack
-	for _, track := range tracks {
-		IDTracks = append(IDTracks, CreateIDTrack(track, data))
+	var n = len(tracks)
+	if n == 0 {
+		return tracks, 0
 	}
-	if err != nil {
-		fmt.Println("Error sorting tracks:", err)
-		return tracks
+	var beginningIdx = GetIndexOfTrack(tracks, data.Manifest.Meta.Beginning)
+	if beginningIdx == -1 {
+		log.Error("sorting tracks: beginning track not found")
+		return tracks, 0
 	}
-	var trackGraph = graph.New(trackHash, graph.Directed(), graph.Weighted(), graph.Rooted())
+
+	var trackGraph = graph.New(trackHash, graph.Directed(), graph.Rooted())
 	for _, track := range tracks {
 		trackGraph.AddVertex(track)
 	}
 	for i, track := range tracks {
-		for _, option := range track.Options {
-			trackGraph.AddEdge(track.ID, tracks[option].ID, graph.EdgeWeight(int(math.Abs(float64(option-i)))))
+		for _, target := range track.Options {
+			if target < 0 || target >= n {
+				continue
+			}
+			trackGraph.AddEdge(track.ID, tracks[target].ID, graph.EdgeWeight(int(math.Abs(float64(target-i)))))
+		}
+	}
+
+	var indexByID = make(map[string]int, n)
+	for i, track := range tracks {
+		indexByID[track.ID] = i
+	}
+	var seen = make([]bool, n)
+	var order []int
+	if bfsErr := graph.BFS(trackGraph, tracks[beginningIdx].ID, func(trackID string) bool {
+		var idx = indexByID[trackID]
+		if !seen[idx] {
+			seen[idx] = true
+			order = append(order, idx)
+		}
+		return false
+	}); bfsErr != nil {
+		log.Error("sorting tracks:", bfsErr)
+		return tracks, 0
+	}
+	for i := 0; i < n; i++ {
+		if !seen[i] {
+			order = append(order, i)
 		}
 	}
-	var tempOutput []Track
-	graph.BFS(trackGraph, beginning.ID, func(trackID string) bool {
-		var _, track = GetTrackByID(tracks, trackID)
-		tempOutput = append(tempOutput, track)
+
+	order = moveToFront(order, beginningIdx)
+	var lastEndIdx = GetIndexOfTrack(tracks, data.ConversionManifest.LastEnd)
+	var lastEndPinned = lastEndIdx != -1 && lastEndIdx != beginningIdx
+	if lastEndPinned {
+		order = moveToBack(order, lastEndIdx)
+	}
+	order = repairEndOrdering(order, tracks, lastEndPinned)
+
+	var position = make([]int, n)
+	for slot, idx := range order {
+		position[idx] = slot
+	}
+
+	var cost = func(pos []int) float64 {
+		var total float64
+		for i, track := range tracks {
+			for _, target := range track.Options {
+				if target < 0 || target >= n {
+					continue
+				}
+				total += math.Abs(float64(pos[target] - pos[i]))
+			}
+		}
+		return total
+	}
+
+	// violatesEndOrdering rejects any candidate ordering that places an
+	// End/NoAppend track before a track whose option redirects to it.
+	var violatesEndOrdering = func(pos []int) bool {
+		for i, track := range tracks {
+			for _, target := range track.Options {
+				if target < 0 || target >= n {
+					continue
+				}
+				if (tracks[target].End || tracks[target].NoAppend) && pos[target] < pos[i] {
+					return true
+				}
+			}
+		}
 		return false
-	})
-	var output []Track = make([]Track, len(tempOutput))
-	for _, track := range IDTracks {
-		for _, option := range track.Options {
-			var i = GetIndexOfTrack(tempOutput, option)
-			if i == -1 {
-				fmt.Println("Error sorting tracks: track not found")
-				return tracks
+	}
+
+	var bestCost = cost(position)
+	var upperBound = n - 1
+	if lastEndPinned {
+		upperBound = n - 2
+	}
+	const maxPasses = 50
+	for pass := 0; pass < maxPasses; pass++ {
+		var improved = false
+		for slot := 1; slot < upperBound; slot++ {
+			var a, b = order[slot], order[slot+1]
+			position[a], position[b] = position[b], position[a]
+			if !violatesEndOrdering(position) {
+				if newCost := cost(position); newCost < bestCost {
+					order[slot], order[slot+1] = b, a
+					bestCost = newCost
+					improved = true
+					continue
+				}
 			}
-			_, output[i] = GetTrackByID(tracks, option)
+			position[a], position[b] = position[b], position[a]
+		}
+		if !improved {
+			break
 		}
 	}
-	return output
+
+	var output = make([]Track, n)
+	for slot, idx := range order {
+		output[slot] = tracks[idx]
+	}
+	return output, bestCost
+}
+
+// Counter tracks how the speech-generation loop resolved each track, so a
+// single grouped summary can be printed once every track has been processed.
+type Counter struct {
+	Success     int // synthesized successfully (cache hits are counted in Cached instead)
+	Error       int // failed after exhausting retries
+	Unavailable int // the TTS service reported itself as unavailable
+	Cached      int // skipped because a matching cached clip already existed
+	Total       int
+}
+
+var speechCounter Counter
+
+const speechRetries = 4
+const speechRetryBaseDelay = 500 * time.Millisecond
+
+var speechCachePath = filepath.Join("out/temp", "cache.json")
+
+// speechCacheEntry records the hash of the text+overrides that produced the
+// cached clip for a track, so CreateSpeech can tell a stale cache entry from
+// a reusable one.
+type speechCacheEntry struct {
+	Hash string `json:"hash"`
+}
+
+func loadSpeechCache() map[string]speechCacheEntry {
+	var cache = make(map[string]speechCacheEntry)
+	var data, err = os.ReadFile(speechCachePath)
+	if err != nil {
+		return cache
+	}
+	json.Unmarshal(data, &cache)
+	return cache
+}
+
+func saveSpeechCache(cache map[string]speechCacheEntry) {
+	var data, err = json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(speechCachePath), 0755)
+	os.WriteFile(speechCachePath, data, 0644)
 }
 
-func CreateSpeech(trackID string, speech string) {
-	var speechV = gtts.Speech{Folder: "out/temp", Language: "en", Handler: nil}
-	speechV.CreateSpeechFile(speech, trackID+".mp3")
+// speechHash hashes the speech text together with the overrides and voice
+// options in effect, so a cached clip is invalidated if any of them change.
+func speechHash(speech string, opts tts.VoiceOptions) string {
+	var overridesData, _ = json.Marshal(currentOverrides)
+	var optsData, _ = json.Marshal(opts)
+	var sum = sha256.Sum256(append(append([]byte(speech), overridesData...), optsData...))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSpeech renders speech to out/temp/<trackID>.mp3 via provider,
+// skipping tracks whose cached audio already matches the current text,
+// overrides and voice options, and retrying transient failures with
+// exponential backoff.
+func CreateSpeech(provider tts.Provider, trackID string, speech string, opts tts.VoiceOptions) error {
+	speechCounter.Total += 1
+	var hash = speechHash(speech, opts)
+	var cache = loadSpeechCache()
+	var outPath = filepath.Join("out/temp", trackID+".mp3")
+	if entry, ok := cache[trackID]; ok && entry.Hash == hash {
+		if _, statErr := os.Stat(outPath); statErr == nil {
+			speechCounter.Cached += 1
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		speechCounter.Error += 1
+		return fmt.Errorf("creating speech output dir: %w", err)
+	}
+
+	var lastErr error
+	var backoff = speechRetryBaseDelay
+	for attempt := 0; attempt < speechRetries; attempt++ {
+		var file *os.File
+		file, lastErr = os.Create(outPath)
+		if lastErr == nil {
+			lastErr = provider.Synthesize(speech, file, opts)
+			file.Close()
+		}
+		if lastErr == nil {
+			break
+		}
+		if attempt < speechRetries-1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	if lastErr != nil {
+		if strings.Contains(strings.ToLower(lastErr.Error()), "unavailable") {
+			speechCounter.Unavailable += 1
+		} else {
+			speechCounter.Error += 1
+		}
+		return fmt.Errorf("generating speech for track %s: %w", trackID, lastErr)
+	}
+
+	cache[trackID] = speechCacheEntry{Hash: hash}
+	saveSpeechCache(cache)
+	speechCounter.Success += 1
+	return nil
 }
 
 func GenerateSpeechFromTrack(track Track, conversionManifest ConversionManifest) string {
+	// track.Options is a map, so iterate a sorted copy of its keys: ranging
+	// over it directly renders the options (and hashes the result) in a
+	// different order on every run, defeating both the spoken "you can X, or
+	// Y" ordering and CreateSpeech's resume cache.
+	var options = make([]string, 0, len(track.Options))
+	for option := range track.Options {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+
 	var text = track.OriginalSpeech
 	text += currentOverrides.Speech_options_separator
 	text += currentOverrides.Options_prefix
-	var i = 0
-	for option, _ := range track.Options {
-		if i != 0 && i != len(track.Options)-1 {
+	for i, option := range options {
+		if i != 0 && i != len(options)-1 {
 			text += currentOverrides.Options_item_separator
-		} else if i == len(track.Options)-1 {
+		} else if i == len(options)-1 {
 			text += currentOverrides.Last_options_item_separator
 		}
 		text += option
-		i += 1
 	}
 	text += ". "
-	for option, _ := range track.Options {
+	for _, option := range options {
 		text += currentOverrides.Options_seconds_prefix
 		text += option
 		if conversionManifest.RedirectType == RedirectTypeTimestamp {
 			text += currentOverrides.Options_timestamp_go_to
 		} else if conversionManifest.RedirectType == RedirectTypeSkip {
 		}
+		text += currentOverrides.Options_timestamp_go_to_suffix
 	}
+	text += currentOverrides.Request_to_pause
+	return text
 }
 
 func main() {
-	fmt.Println("PodCDA: Create a single audio file from a CDAdventure manifest")
-	fmt.Println("Written by Arthur Beck (c) 2024")
-	fmt.Println("Licensed under the GNU Affero General Public License v3.0")
+	log.Info("PodCDA: Create a single audio file from a CDAdventure manifest")
+	log.Info("Written by Arthur Beck (c) 2024")
+	log.Info("Licensed under the GNU Affero General Public License v3.0")
 	flag.Parse()
 	var conversionPath string = flag.Arg(0)
 	var _, openErr = os.Open(conversionPath)
 	if openErr != nil {
 		if os.IsNotExist(openErr) {
-			fmt.Println("Err: conversion manifest does not exist")
+			log.Error("conversion manifest does not exist")
 			return
 		}
-		fmt.Println("Error opening conversion manifest:", openErr)
+		log.Error("opening conversion manifest:", openErr)
 		return
 	}
 	var convData, readErr = os.ReadFile(conversionPath)
 	if readErr != nil {
-		fmt.Println("Error reading conversion manifest:", readErr)
+		log.Error("reading conversion manifest:", readErr)
 		return
 	}
 	var conversionManifest ConversionManifest
 	var jsonErr = json.Unmarshal(convData, &conversionManifest)
 	if jsonErr != nil {
-		fmt.Println("Error parsing conversion manifest:", jsonErr)
+		log.Error("parsing conversion manifest:", jsonErr)
 		return
 	}
 	var valid, errMsg = CheckConversionManifest(conversionManifest)
 	if !valid {
-		fmt.Println("Invalid conversion manifest:", errMsg)
+		log.Error("invalid conversion manifest:", errMsg)
 		return
 	}
 	currentOverrides = conversionManifest.Overrides
@@ -383,35 +775,55 @@ func main() {
 	var preamblePath = filepath.Join(filepath.Dir(conversionPath), conversionManifest.Preamble)
 	var preambleData, readErr2 = os.ReadFile(preamblePath)
 	if readErr2 != nil {
-		fmt.Println("Error reading preamble manifest:", readErr2)
+		log.Error("reading preamble manifest:", readErr2)
 		return
 	}
 	var preamble Preamble
 	var jsonErr2 = json.Unmarshal(preambleData, &preamble)
 	if jsonErr2 != nil {
-		fmt.Println("Error parsing preamble manifest:", jsonErr2)
+		log.Error("parsing preamble manifest:", jsonErr2)
 		return
 	}
 	var valid2, errMsg2 = CheckPreamble(preamble)
 	if !valid2 {
-		fmt.Println("Invalid preamble manifest:", errMsg2)
+		log.Error("invalid preamble manifest:", errMsg2)
 		return
 	}
 	var cdAdventurePath = filepath.Join(filepath.Dir(conversionPath), conversionManifest.Path)
 	var cdAdventureData, readErr3 = os.ReadFile(cdAdventurePath)
 	if readErr3 != nil {
-		fmt.Println("Error reading CDAdventure manifest:", readErr3)
+		log.Error("reading CDAdventure manifest:", readErr3)
 		return
 	}
 	var cdAdventureManifest CDAdventureManifest
 	var jsonErr3 = json.Unmarshal(cdAdventureData, &cdAdventureManifest)
 	if jsonErr3 != nil {
-		fmt.Println("Error parsing CDAdventure manifest:", jsonErr3)
+		log.Error("parsing CDAdventure manifest:", jsonErr3)
 		return
 	}
-	var valid3, errMsg3 = CheckCDAdventureManifest(cdAdventureManifest)
+	if *selectFlag {
+		var selected, selectErr = SelectTracks(cdAdventureManifest.Tracks, *tracksFlag, *fromFlag)
+		if selectErr != nil {
+			log.Error("applying track selection:", selectErr)
+			return
+		}
+		cdAdventureManifest.Tracks = selected
+		// --from/--tracks routinely drop the original Meta.Beginning (and
+		// ConversionManifest.LastEnd) track by design; reassign them to the
+		// first/last surviving track so the narrowed manifest still validates
+		// and sorts instead of failing on a track selection removed on purpose.
+		if len(selected) > 0 {
+			if GetIndexOfTrack(selected, cdAdventureManifest.Meta.Beginning) == -1 {
+				cdAdventureManifest.Meta.Beginning = selected[0].ID
+			}
+			if GetIndexOfTrack(selected, conversionManifest.LastEnd) == -1 {
+				conversionManifest.LastEnd = selected[len(selected)-1].ID
+			}
+		}
+	}
+	var valid3, errMsg3 = CheckCDAdventureManifest(cdAdventureManifest, *selectFlag)
 	if !valid3 {
-		fmt.Println("Invalid CDAdventure manifest:", errMsg3)
+		log.Error("invalid CDAdventure manifest:", errMsg3)
 		return
 	}
 	var cdAdventure = CDAdventure{
@@ -424,6 +836,137 @@ func main() {
 			track.End = true
 		}
 	}
-	cdAdventure.Manifest.Tracks = SortTracks(cdAdventure.Manifest.Tracks, cdAdventure)
-	fmt.Println(cdAdventure.Manifest.Tracks)
+	var originalTracks = append([]Track{}, cdAdventure.Manifest.Tracks...)
+	var sortedTracks, skipCost = SortTracks(cdAdventure.Manifest.Tracks, cdAdventure)
+	cdAdventure.Manifest.Tracks = sortedTracks
+	if cdAdventure.ConversionManifest.Sorter != SorterTypeNone {
+		log.Info(fmt.Sprintf("Sorter %s produced a total skip cost of %.0f", cdAdventure.ConversionManifest.Sorter, skipCost))
+	}
+
+	if *dryRunFlag {
+		log.Info("Dry run: sort order, estimated timestamps and speech text")
+		var elapsed = preamble.Starting_speech_delay
+		for _, track := range cdAdventure.Manifest.Tracks {
+			var text = GenerateSpeechFromTrack(track, cdAdventure.ConversionManifest)
+			fmt.Printf("%s (%s) @ %.1fs: %s\n", track.ID, track.Title, elapsed, text)
+			elapsed += estimateSpeechDuration(text)
+		}
+		return
+	}
+
+	var ttsProvider, ttsErr = tts.New(conversionManifest.TTS)
+	if ttsErr != nil {
+		log.Error("configuring TTS provider:", ttsErr)
+		return
+	}
+	var defaultVoiceOpts = tts.VoiceOptions{Voice: conversionManifest.TTS.Voice, Rate: conversionManifest.TTS.Rate}
+
+	// Under --select, splice the rendered subset around a short stub preamble
+	// instead of the full one, so iterating on a single branch stays fast.
+	var preambleSpeech = preamble.Speech
+	var postSpeech = preamble.Post_speech
+	var preambleMerge = preamble.Merge
+	var preambleUsesFile = preamble.Uses_file
+	if *selectFlag {
+		preambleSpeech = "Selection preview."
+		postSpeech = ""
+		preambleMerge = false
+		preambleUsesFile = false
+	}
+
+	if err := CreateSpeech(ttsProvider, "preamble", preambleSpeech, defaultVoiceOpts); err != nil {
+		log.Warn(err)
+	}
+	var postSpeechPath string
+	if postSpeech != "" {
+		if err := CreateSpeech(ttsProvider, "post_speech", postSpeech, defaultVoiceOpts); err != nil {
+			log.Warn(err)
+		}
+		postSpeechPath = filepath.Join("out/temp", "post_speech.mp3")
+	}
+
+	var clips []audio.Clip
+	var failures []error
+	var bar = progressbar.NewOptions(len(cdAdventure.Manifest.Tracks),
+		progressbar.OptionSetDescription("Synthesizing speech"),
+		progressbar.OptionShowCount(),
+		progressbar.OptionClearOnFinish(),
+	)
+	for _, track := range cdAdventure.Manifest.Tracks {
+		var voiceOpts = defaultVoiceOpts
+		if track.VoiceOverride != "" {
+			voiceOpts.Voice = track.VoiceOverride
+		}
+		if err := CreateSpeech(ttsProvider, track.ID, GenerateSpeechFromTrack(track, cdAdventure.ConversionManifest), voiceOpts); err != nil {
+			bar.Describe(fmt.Sprintf("Synthesizing speech (failed: %s)", track.ID))
+			failures = append(failures, err)
+			bar.Add(1)
+			// os.Create already truncated out/temp/<id>.mp3 before the
+			// provider failed, so skip the clip rather than handing Assemble
+			// an empty/partial file ffprobe can't read.
+			continue
+		}
+		bar.Add(1)
+		var options []audio.OptionEntry
+		for label, targetIndex := range track.Options {
+			if targetIndex < 0 || targetIndex >= len(originalTracks) {
+				continue
+			}
+			options = append(options, audio.OptionEntry{Label: label, TargetID: originalTracks[targetIndex].ID})
+		}
+		clips = append(clips, audio.Clip{ID: track.ID, Title: track.Title, Path: filepath.Join("out/temp", track.ID+".mp3"), Options: options})
+	}
+	bar.Finish()
+
+	log.Info(fmt.Sprintf("Speech generation: %d succeeded, %d cached, %d failed, %d unavailable (of %d total)",
+		speechCounter.Success, speechCounter.Cached, speechCounter.Error, speechCounter.Unavailable, speechCounter.Total))
+	if len(failures) > 0 {
+		log.Warn(fmt.Sprintf("%d track(s) failed speech generation:", len(failures)))
+		for _, failure := range failures {
+			log.Warn(" -", failure)
+		}
+	}
+
+	var preambleAudioFile string
+	if preambleUsesFile {
+		preambleAudioFile = filepath.Join(filepath.Dir(preamblePath), preamble.Audio_file)
+	}
+
+	var muxBar = progressbar.NewOptions(-1,
+		progressbar.OptionSetDescription("Muxing final output"),
+		progressbar.OptionSpinnerType(14),
+	)
+	var muxDone = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-muxDone:
+				return
+			case <-time.After(200 * time.Millisecond):
+				muxBar.Add(1)
+			}
+		}
+	}()
+
+	var chapters, assembleErr = audio.Assemble(audio.Options{
+		OutputPath:          conversionManifest.OutputPath,
+		PreambleSpeechPath:  filepath.Join("out/temp", "preamble.mp3"),
+		PreambleAudioFile:   preambleAudioFile,
+		Merge:               preambleMerge,
+		AudioFileVolume:     preamble.Audio_file_volume,
+		StartingSpeechDelay: preamble.Starting_speech_delay,
+		Clips:               clips,
+		PostSpeechPath:      postSpeechPath,
+		RedirectType:        conversionManifest.RedirectType,
+		SaveLrcFile:         conversionManifest.SaveLrcFile,
+		SaveSrtFile:         conversionManifest.SaveSrtFile,
+		LrcFormat:           currentOverrides.LrcFormat,
+	})
+	close(muxDone)
+	muxBar.Finish()
+	if assembleErr != nil {
+		log.Error("assembling output:", assembleErr)
+		return
+	}
+	log.Info("Wrote", conversionManifest.OutputPath, "with", len(chapters), "chapters")
 }
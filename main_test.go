@@ -0,0 +1,189 @@
+package main
+
+import "testing"
+
+func trackByID(tracks []Track, id string) (int, Track) {
+	for i, track := range tracks {
+		if track.ID == id {
+			return i, track
+		}
+	}
+	return -1, Track{}
+}
+
+// naiveCost computes SortTracks' skip-cost formula (sum of |target position -
+// source position| over every option edge) for tracks taken in their given
+// order, so tests can check SortTracks never returns a worse cost than the
+// identity ordering of its input.
+func naiveCost(tracks []Track) float64 {
+	var total float64
+	for i, track := range tracks {
+		for _, target := range track.Options {
+			if target < 0 || target >= len(tracks) {
+				continue
+			}
+			var d = target - i
+			if d < 0 {
+				d = -d
+			}
+			total += float64(d)
+		}
+	}
+	return total
+}
+
+func TestSortTracksPinsBeginningAndLastEnd(t *testing.T) {
+	var tracks = []Track{
+		{ID: "start", Options: map[string]int{"go": 2}},
+		{ID: "mid", Options: map[string]int{"go": 3}},
+		{ID: "branch", Options: map[string]int{"go": 1}},
+		{ID: "end", End: true},
+	}
+	var data = CDAdventure{
+		ConversionManifest: ConversionManifest{Sorter: SorterTypeShortestSkip, LastEnd: "end"},
+		Manifest:           CDAdventureManifest{Meta: Meta{Beginning: "start"}},
+	}
+
+	var output, _ = SortTracks(tracks, data)
+
+	if len(output) != len(tracks) {
+		t.Fatalf("expected %d tracks, got %d", len(tracks), len(output))
+	}
+	if output[0].ID != "start" {
+		t.Errorf("expected Beginning track pinned at index 0, got %q", output[0].ID)
+	}
+	if output[len(output)-1].ID != "end" {
+		t.Errorf("expected LastEnd track pinned at last index, got %q", output[len(output)-1].ID)
+	}
+}
+
+func TestSortTracksCostNeverWorseThanIdentity(t *testing.T) {
+	var tracks = []Track{
+		{ID: "start", Options: map[string]int{"a": 3, "b": 1}},
+		{ID: "mid", Options: map[string]int{"a": 2}},
+		{ID: "branch", Options: map[string]int{"a": 0}},
+		{ID: "end", End: true},
+	}
+	var data = CDAdventure{
+		ConversionManifest: ConversionManifest{Sorter: SorterTypeShortestSkip, LastEnd: "end"},
+		Manifest:           CDAdventureManifest{Meta: Meta{Beginning: "start"}},
+	}
+
+	var _, cost = SortTracks(tracks, data)
+
+	if identity := naiveCost(tracks); cost > identity {
+		t.Errorf("SortTracks cost %.1f is worse than identity-order cost %.1f", cost, identity)
+	}
+}
+
+// TestSortTracksEndNeverPrecedesPredecessor builds a graph where the BFS seed
+// is guaranteed to place a non-LastEnd End track before a track whose option
+// redirects to it, regardless of which tie the underlying BFS happens to
+// visit first, to exercise repairEndOrdering rather than just the swap guard.
+func TestSortTracksEndNeverPrecedesPredecessor(t *testing.T) {
+	var tracks = []Track{
+		{ID: "start", Options: map[string]int{"toMid": 1, "toBranch": 2}},
+		{ID: "mid", Options: map[string]int{"toOther": 3}},
+		{ID: "branch", End: true},
+		{ID: "other", Options: map[string]int{"toBranch": 2, "toFinal": 4}},
+		{ID: "finalEnd", End: true},
+	}
+	var data = CDAdventure{
+		ConversionManifest: ConversionManifest{Sorter: SorterTypeShortestSkip, LastEnd: "finalEnd"},
+		Manifest:           CDAdventureManifest{Meta: Meta{Beginning: "start"}},
+	}
+
+	var output, _ = SortTracks(tracks, data)
+
+	var position = make(map[string]int, len(output))
+	for i, track := range output {
+		position[track.ID] = i
+	}
+	for _, track := range tracks {
+		for _, targetIdx := range track.Options {
+			var target = tracks[targetIdx]
+			if !(target.End || target.NoAppend) {
+				continue
+			}
+			if position[target.ID] < position[track.ID] {
+				t.Errorf("End track %q (position %d) precedes predecessor %q (position %d)",
+					target.ID, position[target.ID], track.ID, position[track.ID])
+			}
+		}
+	}
+}
+
+func TestSortTracksNone(t *testing.T) {
+	var tracks = []Track{{ID: "a"}, {ID: "b"}}
+	var data = CDAdventure{ConversionManifest: ConversionManifest{Sorter: SorterTypeNone}}
+
+	var output, cost = SortTracks(tracks, data)
+
+	if cost != 0 {
+		t.Errorf("expected zero cost for SorterTypeNone, got %.1f", cost)
+	}
+	if output[0].ID != "a" || output[1].ID != "b" {
+		t.Errorf("expected tracks unchanged for SorterTypeNone, got %v", output)
+	}
+}
+
+func TestSelectTracksRemapsOptions(t *testing.T) {
+	var tracks = []Track{
+		{ID: "t1", Options: map[string]int{"a": 1}},
+		{ID: "t2", Options: map[string]int{"a": 3}},
+		{ID: "t3", Options: map[string]int{"a": 3}},
+		{ID: "t4", End: true},
+	}
+
+	var filtered, err = SelectTracks(tracks, "1,3-4", "")
+	if err != nil {
+		t.Fatalf("SelectTracks: %v", err)
+	}
+	if len(filtered) != 3 {
+		t.Fatalf("expected 3 kept tracks, got %d: %v", len(filtered), filtered)
+	}
+	if filtered[0].ID != "t1" || filtered[1].ID != "t3" || filtered[2].ID != "t4" {
+		t.Fatalf("unexpected filtered order: %v", filtered)
+	}
+
+	// t1's option pointed at t2, which was excluded by the selection; it
+	// should be dropped, leaving t1 with no options (and thus marked End).
+	if len(filtered[0].Options) != 0 {
+		t.Errorf("expected dangling option dropped, got %v", filtered[0].Options)
+	}
+	if !filtered[0].End {
+		t.Errorf("expected track left with no options to be marked End")
+	}
+
+	// t3's option pointed at t4, which survived the selection at index 2.
+	var idx, kept = trackByID(filtered, "t3")
+	if idx == -1 {
+		t.Fatalf("t3 missing from filtered tracks")
+	}
+	if kept.Options["a"] != 2 {
+		t.Errorf("expected t3's option remapped to index 2, got %d", kept.Options["a"])
+	}
+}
+
+func TestSelectTracksFrom(t *testing.T) {
+	var tracks = []Track{
+		{ID: "t1", Options: map[string]int{"a": 1}},
+		{ID: "t2", Options: map[string]int{"a": 2}},
+		{ID: "t3", End: true},
+	}
+
+	var filtered, err = SelectTracks(tracks, "", "t2")
+	if err != nil {
+		t.Fatalf("SelectTracks: %v", err)
+	}
+	if len(filtered) != 2 || filtered[0].ID != "t2" || filtered[1].ID != "t3" {
+		t.Fatalf("unexpected filtered tracks: %v", filtered)
+	}
+	if filtered[0].Options["a"] != 1 {
+		t.Errorf("expected t2's option remapped to index 1, got %d", filtered[0].Options["a"])
+	}
+
+	if _, err := SelectTracks(tracks, "", "missing"); err == nil {
+		t.Errorf("expected error for --from track not found")
+	}
+}
@@ -0,0 +1,203 @@
+// Package tts defines a pluggable text-to-speech backend for the
+// speech-generation pipeline, along with a gtts-backed default provider,
+// offline exec-based providers (espeak, piper), and an HTTP-based cloud
+// provider (e.g. ElevenLabs, Amazon Polly, Azure).
+package tts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+
+	gtts "github.com/Duckduckgot/gtts"
+)
+
+// VoiceOptions configures how a provider should render a given piece of
+// text: which voice to use and how fast to speak it.
+type VoiceOptions struct {
+	Voice string  // provider-specific voice id, "" for the provider's default
+	Rate  float64 // speaking rate multiplier, 0 for the provider's default
+}
+
+// Provider synthesizes text to speech, writing the resulting audio to out.
+type Provider interface {
+	Synthesize(text string, out io.Writer, opts VoiceOptions) error
+}
+
+// GTTS is the default provider, backed by github.com/Duckduckgot/gtts. It
+// requires network access.
+type GTTS struct {
+	Language string // default language/voice, overridden by VoiceOptions.Voice
+}
+
+func (p GTTS) Synthesize(text string, out io.Writer, opts VoiceOptions) error {
+	var workDir, err = os.MkdirTemp("", "podcda-gtts")
+	if err != nil {
+		return fmt.Errorf("creating gtts work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	var language = p.Language
+	if opts.Voice != "" {
+		language = opts.Voice
+	}
+	if language == "" {
+		language = "en"
+	}
+	var speechV = gtts.Speech{Folder: workDir, Language: language, Handler: nil}
+	if err := speechV.CreateSpeechFile(text, "out.mp3"); err != nil {
+		return fmt.Errorf("gtts synthesis: %w", err)
+	}
+	var data, readErr = os.ReadFile(workDir + "/out.mp3")
+	if readErr != nil {
+		return fmt.Errorf("reading gtts output: %w", readErr)
+	}
+	_, writeErr := out.Write(data)
+	return writeErr
+}
+
+// Exec runs an offline command-line synthesizer such as espeak or piper,
+// piping text to stdin and transcoding its raw stdout output to MP3 via
+// ffmpeg, since each tool emits a different raw format (espeak: WAV, piper
+// --output-raw: headerless 16-bit PCM) but CreateSpeech always writes
+// rendered clips as out/temp/<id>.mp3.
+type Exec struct {
+	Command string   // e.g. "espeak" or "piper"
+	Args    []string // extra arguments, before the voice/rate flags
+}
+
+// rawFormatArgs returns the ffmpeg input-format flags needed to decode
+// p.Command's raw stdout output.
+func (p Exec) rawFormatArgs() []string {
+	switch p.Command {
+	case "piper":
+		return []string{"-f", "s16le", "-ar", "22050", "-ac", "1"}
+	default: // espeak and other WAV-emitting tools
+		return []string{"-f", "wav"}
+	}
+}
+
+func (p Exec) Synthesize(text string, out io.Writer, opts VoiceOptions) error {
+	var args = append([]string{}, p.Args...)
+	switch p.Command {
+	case "piper":
+		if opts.Voice != "" {
+			args = append(args, "--model", opts.Voice)
+		}
+		// piper has no rate flag; opts.Rate is ignored for this provider.
+		args = append(args, "--output-raw")
+	default: // espeak
+		if opts.Voice != "" {
+			args = append(args, "-v", opts.Voice)
+		}
+		if opts.Rate != 0 {
+			// espeak's -s is words per minute, 175 by default.
+			args = append(args, "-s", fmt.Sprintf("%.0f", opts.Rate*175))
+		}
+		args = append(args, "--stdout")
+	}
+	var cmd = exec.Command(p.Command, args...)
+	cmd.Stdin = bytes.NewBufferString(text)
+	var raw bytes.Buffer
+	cmd.Stdout = &raw
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w\n%s", p.Command, err, stderr.String())
+	}
+	return transcodeToMP3(raw.Bytes(), p.rawFormatArgs(), out)
+}
+
+// transcodeToMP3 shells out to ffmpeg to convert raw, decoded per
+// formatArgs, into MP3 written to out.
+func transcodeToMP3(raw []byte, formatArgs []string, out io.Writer) error {
+	var args = append(append([]string{"-y"}, formatArgs...), "-i", "pipe:0", "-f", "mp3", "pipe:1")
+	var cmd = exec.Command("ffmpeg", args...)
+	cmd.Stdin = bytes.NewReader(raw)
+	cmd.Stdout = out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg transcode: %w\n%s", err, stderr.String())
+	}
+	return nil
+}
+
+// HTTP synthesizes speech via a cloud REST API, POSTing the text and voice
+// options as JSON and streaming back the returned audio.
+type HTTP struct {
+	Endpoint string
+	APIKey   string
+	Client   *http.Client
+}
+
+func (p HTTP) Synthesize(text string, out io.Writer, opts VoiceOptions) error {
+	var client = p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var body, marshalErr = json.Marshal(map[string]interface{}{
+		"text":  text,
+		"voice": opts.Voice,
+		"rate":  opts.Rate,
+	})
+	if marshalErr != nil {
+		return fmt.Errorf("encoding request: %w", marshalErr)
+	}
+	var req, reqErr = http.NewRequest(http.MethodPost, p.Endpoint, bytes.NewReader(body))
+	if reqErr != nil {
+		return fmt.Errorf("building request: %w", reqErr)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	var resp, doErr = client.Do(req)
+	if doErr != nil {
+		return fmt.Errorf("calling %s: %w", p.Endpoint, doErr)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", p.Endpoint, resp.StatusCode)
+	}
+	_, copyErr := io.Copy(out, resp.Body)
+	return copyErr
+}
+
+const ProviderGTTS = "gtts"
+const ProviderEspeak = "espeak"
+const ProviderPiper = "piper"
+const ProviderHTTP = "http"
+
+// Config selects and configures a provider, matching the TTS section of a
+// ConversionManifest.
+type Config struct {
+	Provider string  // ProviderGTTS (default), ProviderEspeak, ProviderPiper, or ProviderHTTP
+	Voice    string  // default voice id, overridable per-track
+	Rate     float64 // default speaking rate, 0 for the provider's default
+	Endpoint string  // required for ProviderHTTP
+	APIKey   string  // optional bearer token for ProviderHTTP, sent only when set
+}
+
+// New builds the Provider described by cfg.
+func New(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case "", ProviderGTTS:
+		return GTTS{}, nil
+	case ProviderEspeak:
+		return Exec{Command: "espeak"}, nil
+	case ProviderPiper:
+		return Exec{Command: "piper"}, nil
+	case ProviderHTTP:
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("http provider requires an endpoint")
+		}
+		return HTTP{Endpoint: cfg.Endpoint, APIKey: cfg.APIKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown TTS provider %q", cfg.Provider)
+	}
+}